@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// runBucketMode walks every key under prefix in bucket, paginating through
+// the full listing rather than the first 10000 keys, and fans the fix
+// pipeline out across concurrency workers. It returns once every key has
+// been processed, ctx is canceled, or listing the bucket fails.
+func runBucketMode(ctx context.Context, svc *s3.S3, bucket, prefix string, concurrency int, opts fixOptions) error {
+	keys := make(chan string)
+	var fixed, skipped, failed int64
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				if ctx.Err() != nil {
+					atomic.AddInt64(&skipped, 1)
+					continue
+				}
+				if err := fixObject(ctx, svc, bucket, key, opts); err != nil {
+					if isUnsupportedCodec(err) {
+						log.Printf("Skipping item %q, %v", key, err)
+						atomic.AddInt64(&skipped, 1)
+						continue
+					}
+					log.Printf("Unable to fix item %q, %v", key, err)
+					atomic.AddInt64(&failed, 1)
+					continue
+				}
+				atomic.AddInt64(&fixed, 1)
+			}
+		}()
+	}
+
+	listErr := svc.ListObjectsV2PagesWithContext(ctx,
+		&s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)},
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, item := range page.Contents {
+				select {
+				case keys <- *item.Key:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return ctx.Err() == nil
+		},
+	)
+	close(keys)
+	wg.Wait()
+
+	log.Printf("Summary: fixed=%d skipped=%d failed=%d", fixed, skipped, failed)
+
+	if listErr != nil {
+		return fmt.Errorf("unable to list items in bucket %q, %v", bucket, listErr)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d item(s) failed to fix", failed)
+	}
+	return nil
+}
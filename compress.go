@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// codec identifies the compression format an S3 object is stored in.
+type codec string
+
+const (
+	codecNone  codec = ""
+	codecGzip  codec = "gzip"
+	codecBzip2 codec = "bzip2"
+)
+
+// detectCodec sniffs the object's Content-Encoding header and, failing
+// that, its key suffix, to work out how it's compressed.
+func detectCodec(key string, contentEncoding *string) codec {
+	if contentEncoding != nil {
+		switch codec(*contentEncoding) {
+		case codecGzip, codecBzip2:
+			return codec(*contentEncoding)
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(key, ".gz"):
+		return codecGzip
+	case strings.HasSuffix(key, ".bz2"):
+		return codecBzip2
+	}
+	return codecNone
+}
+
+// decompress wraps r so reads return the object's decompressed bytes.
+func decompress(c codec, r io.Reader) (io.Reader, error) {
+	switch c {
+	case codecGzip:
+		return gzip.NewReader(r)
+	case codecBzip2:
+		return bzip2.NewReader(r), nil
+	default:
+		return r, nil
+	}
+}
+
+// compress re-compresses body with c, matching the codec the object was
+// read with so the write-back round-trips the same storage format.
+//
+// compress/bzip2 in the standard library only exposes a reader, there's no
+// writer, so a bzip2 object can't be re-compressed into its original format;
+// writing it back uncompressed would silently change what's stored under a
+// ".bz2"-suffixed key, so it's reported as unsupported instead.
+func compress(c codec, body []byte) (data []byte, contentEncoding string, err error) {
+	switch c {
+	case codecGzip:
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		if _, err := gw.Write(body); err != nil {
+			return nil, "", fmt.Errorf("unable to gzip object contents, %v", err)
+		}
+		if err := gw.Close(); err != nil {
+			return nil, "", fmt.Errorf("unable to gzip object contents, %v", err)
+		}
+		return buf.Bytes(), "gzip", nil
+	case codecBzip2:
+		return nil, "", &unsupportedCodecError{codec: c}
+	default:
+		return body, "", nil
+	}
+}
+
+// unsupportedCodecError signals that a key was read with a codec this tool
+// can decompress but not re-compress, so it was left untouched rather than
+// written back in the wrong format.
+type unsupportedCodecError struct{ codec codec }
+
+func (e *unsupportedCodecError) Error() string {
+	return fmt.Sprintf("unable to re-compress with codec %q, no writer available", e.codec)
+}
+
+// isUnsupportedCodec reports whether err means the object was skipped
+// because its codec can't be re-compressed.
+func isUnsupportedCodec(err error) bool {
+	_, ok := err.(*unsupportedCodecError)
+	return ok
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestDetectCodec(t *testing.T) {
+	gzipEncoding := "gzip"
+	bzip2Encoding := "bzip2"
+	otherEncoding := "identity"
+
+	tests := []struct {
+		name            string
+		key             string
+		contentEncoding *string
+		want            codec
+	}{
+		{name: "Content-Encoding gzip wins over key suffix", key: "events/one.json", contentEncoding: &gzipEncoding, want: codecGzip},
+		{name: "Content-Encoding bzip2 wins over key suffix", key: "events/one.json", contentEncoding: &bzip2Encoding, want: codecBzip2},
+		{name: "unrecognized Content-Encoding falls back to key suffix", key: "events/one.json.gz", contentEncoding: &otherEncoding, want: codecGzip},
+		{name: ".gz suffix with no Content-Encoding", key: "events/one.json.gz", contentEncoding: nil, want: codecGzip},
+		{name: ".bz2 suffix with no Content-Encoding", key: "events/one.json.bz2", contentEncoding: nil, want: codecBzip2},
+		{name: "no suffix and no Content-Encoding", key: "events/one.json", contentEncoding: nil, want: codecNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectCodec(tt.key, tt.contentEncoding); got != tt.want {
+				t.Errorf("detectCodec(%q, %v) = %q, want %q", tt.key, tt.contentEncoding, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressDecompressGzipRoundTrip(t *testing.T) {
+	body := []byte(`{"key":"value"}`)
+
+	data, contentEncoding, err := compress(codecGzip, body)
+	if err != nil {
+		t.Fatalf("compress returned error: %v", err)
+	}
+	if contentEncoding != "gzip" {
+		t.Errorf("contentEncoding = %q, want %q", contentEncoding, "gzip")
+	}
+
+	reader, err := decompress(codecGzip, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decompress returned error: %v", err)
+	}
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("unable to read decompressed body: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("round-tripped body = %q, want %q", got, body)
+	}
+}
+
+func TestCompressNoneLeavesBodyUntouched(t *testing.T) {
+	body := []byte(`{"key":"value"}`)
+
+	data, contentEncoding, err := compress(codecNone, body)
+	if err != nil {
+		t.Fatalf("compress returned error: %v", err)
+	}
+	if contentEncoding != "" {
+		t.Errorf("contentEncoding = %q, want empty", contentEncoding)
+	}
+	if !bytes.Equal(data, body) {
+		t.Errorf("data = %q, want %q", data, body)
+	}
+}
+
+func TestCompressBzip2IsUnsupported(t *testing.T) {
+	_, _, err := compress(codecBzip2, []byte(`{"key":"value"}`))
+	if err == nil {
+		t.Fatal("compress(codecBzip2, ...) returned no error, want one")
+	}
+	if !isUnsupportedCodec(err) {
+		t.Errorf("isUnsupportedCodec(err) = false, want true (err: %v)", err)
+	}
+}
+
+func TestDecompressBzip2ReturnsAReader(t *testing.T) {
+	// compress/bzip2 only exposes a reader, so decompress just wraps it;
+	// unlike gzip.NewReader, bzip2.NewReader doesn't validate the header
+	// eagerly, so this only asserts wiring, not that our tool can produce
+	// a bzip2 stream to decompress.
+	reader, err := decompress(codecBzip2, bytes.NewReader([]byte("not a real bzip2 stream")))
+	if err != nil {
+		t.Fatalf("decompress returned error: %v", err)
+	}
+	if reader == nil {
+		t.Fatal("decompress returned a nil reader")
+	}
+}
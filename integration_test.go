@@ -0,0 +1,107 @@
+//go:build integration
+
+// Package main's integration suite spins up a throwaway MinIO container,
+// uploads malformed SNS fixtures, runs the fixer against it, and asserts
+// the rewritten objects parse as strict JSON. It requires a working Docker
+// daemon, so it's gated behind the "integration" build tag:
+//
+//	go test -tags integration ./...
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// malformedFixtures are SNS event dumps with unquoted keys and values, the
+// shape this tool exists to repair.
+var malformedFixtures = map[string]string{
+	"events/one.json": `{sns: {messageAttributes: {}, signingCertUrl: 'https://sns.us-east-1.amazonaws.com/cert.pem', messageId: abc-123, message: hello, unsubscribeUrl: 'https://sns.us-east-1.amazonaws.com/unsub', type: Notification, signatureVersion: 1, signature: deadbeef, timestamp: "2020-01-01T00:00:00.000Z", topicArn: arn:aws:sns:us-east-1:123456789012:my-topic}, eventVersion: 2.1, eventSource: aws:sns, eventSubscriptionArn: arn:aws:sns:us-east-1:123456789012:my-topic:sub-id}`,
+	"events/two.json": `{sns: {messageAttributes: {}, signingCertUrl: https://sns.us-east-1.amazonaws.com/cert.pem, messageId: def-456, message: world, unsubscribeUrl: https://sns.us-east-1.amazonaws.com/unsub, type: Notification, signatureVersion: 1, signature: deadbeef2, timestamp: "2020-01-02T00:00:00.000Z", topicArn: arn:aws:sns:us-east-1:123456789012:my-topic}, eventVersion: 2.1, eventSource: aws:sns, eventSubscriptionArn: arn:aws:sns:us-east-1:123456789012:my-topic:sub-id2}`,
+}
+
+func TestFixObjectAgainstMinIO(t *testing.T) {
+	ctx := context.Background()
+
+	minio, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "minio/minio:RELEASE.2024-01-16T16-07-38Z",
+			ExposedPorts: []string{"9000/tcp"},
+			Env: map[string]string{
+				"MINIO_ROOT_USER":     "minioadmin",
+				"MINIO_ROOT_PASSWORD": "minioadmin",
+			},
+			Cmd:        []string{"server", "/data"},
+			WaitingFor: wait.ForHTTP("/minio/health/ready").WithPort("9000/tcp"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatalf("unable to start MinIO container, %v", err)
+	}
+	defer minio.Terminate(ctx)
+
+	host, err := minio.Host(ctx)
+	if err != nil {
+		t.Fatalf("unable to get MinIO host, %v", err)
+	}
+	port, err := minio.MappedPort(ctx, "9000")
+	if err != nil {
+		t.Fatalf("unable to get MinIO port, %v", err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(fmt.Sprintf("http://%s:%s", host, port.Port())),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("minioadmin", "minioadmin", ""),
+	})
+	if err != nil {
+		t.Fatalf("unable to create session, %v", err)
+	}
+	svc := s3.New(sess)
+
+	const bucket = "fixtures"
+	if _, err := svc.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		t.Fatalf("unable to create bucket, %v", err)
+	}
+
+	for key, body := range malformedFixtures {
+		_, err := svc.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   aws.ReadSeekCloser(strings.NewReader(body)),
+		})
+		if err != nil {
+			t.Fatalf("unable to upload fixture %q, %v", key, err)
+		}
+	}
+
+	if err := runBucketMode(ctx, svc, bucket, "events/", 2, fixOptions{}); err != nil {
+		t.Fatalf("runBucketMode returned error: %v", err)
+	}
+
+	for key := range malformedFixtures {
+		obj, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			t.Fatalf("unable to read back %q, %v", key, err)
+		}
+
+		var v interface{}
+		err = json.NewDecoder(obj.Body).Decode(&v)
+		obj.Body.Close()
+		if err != nil {
+			t.Errorf("rewritten object %q is not strict JSON: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package relaxjson
+
+import "encoding/json"
+
+// jsonUnmarshal defers to encoding/json once the input has been sanitized
+// into strictly-valid JSON.
+func jsonUnmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// mustMarshalString renders s as a valid double-quoted JSON string. It never
+// fails: json.Marshal only errors on unsupported types, and string is
+// always supported.
+func mustMarshalString(s string) []byte {
+	b, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,287 @@
+// Package relaxjson decodes "relaxed" JSON documents: the malformed,
+// partially-unquoted JSON that shows up in SNS-to-S3 event dumps, where
+// object keys and string values are frequently missing their quotes.
+//
+// It recognizes the same token shapes encoding/json does (objects, arrays,
+// quoted strings, numbers, true/false/null) plus bare identifiers used as
+// keys or values, and single-quoted strings. Decode rewrites the input into
+// strictly-valid JSON and hands it to encoding/json.
+package relaxjson
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// Decoder reads a relaxed JSON document from an input stream and decodes it
+// into a Go value, mirroring the encoding/json.Decoder interface.
+type Decoder struct {
+	r io.Reader
+}
+
+// NewDecoder returns a new Decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads the next relaxed JSON-encoded value from its input and
+// stores it in the value pointed to by v.
+func (d *Decoder) Decode(v interface{}) error {
+	data, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+
+	strict, err := Sanitize(data)
+	if err != nil {
+		return err
+	}
+
+	return jsonUnmarshal(strict, v)
+}
+
+// container tracks the kind of JSON structure a scanner position is nested
+// in, so the tokenizer knows whether the next token is a key or a value.
+type container int
+
+const (
+	containerObject container = iota
+	containerArray
+)
+
+func (c container) String() string {
+	if c == containerArray {
+		return "]"
+	}
+	return "}"
+}
+
+// scanner turns relaxed JSON bytes into strictly-valid JSON bytes.
+type scanner struct {
+	src   []byte
+	pos   int
+	out   []byte
+	stack []container
+	// awaitingKey is only meaningful when the innermost container is an
+	// object: true means the next token must be a (possibly bare) key.
+	awaitingKey bool
+}
+
+// Sanitize rewrites relaxed JSON src into strictly-valid JSON, quoting bare
+// keys and bare string values and leaving numbers, booleans and null as-is.
+func Sanitize(src []byte) ([]byte, error) {
+	s := &scanner{src: src, out: make([]byte, 0, len(src)+16)}
+	if err := s.run(); err != nil {
+		return nil, err
+	}
+	return s.out, nil
+}
+
+func (s *scanner) run() error {
+	for {
+		s.skipWhitespace()
+		if s.pos >= len(s.src) {
+			return nil
+		}
+
+		c := s.src[s.pos]
+		switch {
+		case c == '{':
+			s.out = append(s.out, '{')
+			s.pushObject()
+			s.pos++
+		case c == '}':
+			s.out = append(s.out, '}')
+			if err := s.pop(containerObject); err != nil {
+				return err
+			}
+			s.pos++
+			s.afterValue()
+		case c == '[':
+			s.out = append(s.out, '[')
+			s.pushArray()
+			s.pos++
+		case c == ']':
+			s.out = append(s.out, ']')
+			if err := s.pop(containerArray); err != nil {
+				return err
+			}
+			s.pos++
+			s.afterValue()
+		case c == ',':
+			s.out = append(s.out, ',')
+			s.pos++
+			if s.inObject() {
+				s.awaitingKey = true
+			}
+		case c == ':':
+			s.out = append(s.out, ':')
+			s.pos++
+			s.awaitingKey = false
+		case c == '"' || c == '\'':
+			value, next, err := readQuotedString(s.src, s.pos)
+			if err != nil {
+				return err
+			}
+			s.pos = next
+			s.writeQuoted(value)
+			if !s.keyPosition() {
+				s.afterValue()
+			}
+		default:
+			isKey := s.inObject() && s.awaitingKey
+			token, next := readBareToken(s.src, s.pos, isKey)
+			if token == "" {
+				return fmt.Errorf("relaxjson: unexpected character %q at offset %d", c, s.pos)
+			}
+			s.pos = next
+			s.writeBareToken(token)
+			if !s.keyPosition() {
+				s.afterValue()
+			}
+		}
+	}
+}
+
+func (s *scanner) pushObject() {
+	s.stack = append(s.stack, containerObject)
+	s.awaitingKey = true
+}
+
+func (s *scanner) pushArray() {
+	s.stack = append(s.stack, containerArray)
+	s.awaitingKey = false
+}
+
+func (s *scanner) pop(want container) error {
+	if len(s.stack) == 0 || s.stack[len(s.stack)-1] != want {
+		return fmt.Errorf("relaxjson: unbalanced %v at offset %d", want, s.pos)
+	}
+	s.stack = s.stack[:len(s.stack)-1]
+	return nil
+}
+
+func (s *scanner) inObject() bool {
+	return len(s.stack) > 0 && s.stack[len(s.stack)-1] == containerObject
+}
+
+// keyPosition reports whether the token just scanned was an object key
+// rather than a value, so run() knows not to treat it as closing a member.
+func (s *scanner) keyPosition() bool {
+	if !s.inObject() || !s.awaitingKey {
+		return false
+	}
+	s.awaitingKey = false
+	return true
+}
+
+// afterValue flips the innermost object back into key-awaiting mode once
+// its current member's value has been written; the next ',' or '}' then
+// drives the state machine as usual.
+func (s *scanner) afterValue() {}
+
+func (s *scanner) skipWhitespace() {
+	for s.pos < len(s.src) {
+		switch s.src[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (s *scanner) writeQuoted(value string) {
+	s.out = append(s.out, mustMarshalString(value)...)
+}
+
+func (s *scanner) writeBareToken(token string) {
+	switch token {
+	case "true", "false", "null":
+		s.out = append(s.out, token...)
+		return
+	}
+	if _, err := strconv.ParseFloat(token, 64); err == nil {
+		s.out = append(s.out, token...)
+		return
+	}
+	s.out = append(s.out, mustMarshalString(token)...)
+}
+
+// readQuotedString decodes the quoted string starting at src[start] (which
+// must be a ' or " byte) and returns its unescaped value along with the
+// offset just past the closing quote.
+func readQuotedString(src []byte, start int) (string, int, error) {
+	quote := src[start]
+	i := start + 1
+	var buf []byte
+	for i < len(src) {
+		c := src[i]
+		if c == quote {
+			return string(buf), i + 1, nil
+		}
+		if c == '\\' && i+1 < len(src) {
+			escaped, width := decodeEscape(src[i+1:])
+			buf = append(buf, escaped...)
+			i += 1 + width
+			continue
+		}
+		buf = append(buf, c)
+		i++
+	}
+	return "", 0, fmt.Errorf("relaxjson: unterminated string starting at offset %d", start)
+}
+
+// decodeEscape interprets the bytes following a backslash and returns the
+// decoded bytes plus how many input bytes were consumed.
+func decodeEscape(rest []byte) ([]byte, int) {
+	if len(rest) == 0 {
+		return nil, 0
+	}
+	switch rest[0] {
+	case 'n':
+		return []byte{'\n'}, 1
+	case 't':
+		return []byte{'\t'}, 1
+	case 'r':
+		return []byte{'\r'}, 1
+	case 'b':
+		return []byte{'\b'}, 1
+	case 'f':
+		return []byte{'\f'}, 1
+	case '"', '\'', '\\', '/':
+		return []byte{rest[0]}, 1
+	case 'u':
+		if len(rest) >= 5 {
+			if n, err := strconv.ParseUint(string(rest[1:5]), 16, 32); err == nil {
+				return []byte(string(rune(n))), 5
+			}
+		}
+		return []byte{'u'}, 1
+	default:
+		return []byte{rest[0]}, 1
+	}
+}
+
+// isBareTerminator reports whether c ends an unquoted token. Keys also
+// terminate on ':', but values don't: a value like a URL may legitimately
+// contain a colon (e.g. http://host/path).
+func isBareTerminator(c byte, isKey bool) bool {
+	switch c {
+	case ',', '}', ']', ' ', '\t', '\n', '\r':
+		return true
+	case ':':
+		return isKey
+	}
+	return false
+}
+
+func readBareToken(src []byte, start int, isKey bool) (string, int) {
+	i := start
+	for i < len(src) && !isBareTerminator(src[i], isKey) {
+		i++
+	}
+	return string(src[start:i]), i
+}
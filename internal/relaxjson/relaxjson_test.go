@@ -0,0 +1,109 @@
+package relaxjson
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "bare keys and bare string values",
+			in:   `{key: value, other: 'single quoted'}`,
+			want: `{"key":"value","other":"single quoted"}`,
+		},
+		{
+			name: "bare numbers, booleans and null are left unquoted",
+			in:   `{count: 12, ratio: -3.5, active: true, deleted: false, owner: null}`,
+			want: `{"count":12,"ratio":-3.5,"active":true,"deleted":false,"owner":null}`,
+		},
+		{
+			name: "exponent numbers",
+			in:   `{size: 1.5e10}`,
+			want: `{"size":1.5e10}`,
+		},
+		{
+			name: "value containing a colon is not split on the colon",
+			in:   `{url: http://example.com/path?x=1&y=2}`,
+			want: `{"url":"http://example.com/path?x=1&y=2"}`,
+		},
+		{
+			name: "nested objects and arrays",
+			in:   `{s3: {bucket: {name: my-bucket}, keys: [a, b, c]}}`,
+			want: `{"s3":{"bucket":{"name":"my-bucket"},"keys":["a","b","c"]}}`,
+		},
+		{
+			name: "already-quoted keys and values pass through untouched",
+			in:   `{"key": "value, with a comma", "n": 1}`,
+			want: `{"key":"value, with a comma","n":1}`,
+		},
+		{
+			name: "escaped quotes inside a string",
+			in:   `{message: "she said \"hi\""}`,
+			want: `{"message":"she said \"hi\""}`,
+		},
+		{
+			name: "single quoted string containing a colon and a comma",
+			in:   `{message: 'a:b,c'}`,
+			want: `{"message":"a:b,c"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got interface{}
+			if err := NewDecoder(strings.NewReader(tt.in)).Decode(&got); err != nil {
+				t.Fatalf("Decode(%q) returned error: %v", tt.in, err)
+			}
+
+			// tt.want is already strict JSON, so it's decoded with the
+			// standard library directly rather than through NewDecoder -
+			// otherwise a tokenizer bug in relaxjson could corrupt got and
+			// want identically and the comparison below would never catch it.
+			var want interface{}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatalf("Unmarshal(%q) (expected strict JSON) returned error: %v", tt.want, err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Decode(%q) = %#v, want %#v (from %q)", tt.in, got, want, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeProducesValidJSON(t *testing.T) {
+	in := `{
+		sns: {
+			messageAttributes: {},
+			signingCertUrl: 'https://sns.us-east-1.amazonaws.com/cert.pem',
+			messageId: abc-123,
+			message: nested-value,
+			unsubscribeUrl: https://sns.us-east-1.amazonaws.com/unsub,
+			type: Notification,
+			signatureVersion: 1,
+			signature: deadbeef,
+			timestamp: "2020-01-01T00:00:00.000Z",
+			topicArn: arn:aws:sns:us-east-1:123456789012:my-topic
+		},
+		eventVersion: 2.1,
+		eventSource: aws:sns,
+		eventSubscriptionArn: arn:aws:sns:us-east-1:123456789012:my-topic:sub-id
+	}`
+
+	out, err := Sanitize([]byte(in))
+	if err != nil {
+		t.Fatalf("Sanitize returned error: %v", err)
+	}
+
+	var v map[string]interface{}
+	if err := NewDecoder(strings.NewReader(string(out))).Decode(&v); err != nil {
+		t.Fatalf("sanitized output is not valid JSON: %v\noutput: %s", err, out)
+	}
+}
@@ -1,20 +1,24 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"regexp"
+	"os/signal"
+	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/geektimus/s3-format-fixer/internal/relaxjson"
 )
 
 type snsTimestamp int64
@@ -89,18 +93,50 @@ func exitErrorf(msg string, args ...interface{}) {
 	os.Exit(1)
 }
 
+// fixOptions controls how a fixed object gets written back.
+type fixOptions struct {
+	// dryRun, when true, parses and re-marshals each object but never
+	// writes anything back.
+	dryRun bool
+	// backup, when true, writes the object's original bytes to a ".bak"
+	// sibling key before overwriting it.
+	backup bool
+}
+
 func main() {
-	if len(os.Args) != 3 {
-		exitErrorf("Bucket name is required\nUsage: go run s3-format-fixer bucket prefix")
+	if len(os.Args) >= 2 && os.Args[1] == "sqs" {
+		sqsFlags := flag.NewFlagSet("sqs", flag.ExitOnError)
+		concurrency := sqsFlags.Int("concurrency", runtime.NumCPU(), "number of notifications to fix concurrently")
+		dryRun := sqsFlags.Bool("dry-run", false, "parse and re-marshal without writing the result back")
+		backup := sqsFlags.Bool("backup", false, "write the original object to a .bak sibling key before overwriting it")
+		endpoint := registerEndpointFlags(sqsFlags)
+		sqsFlags.Parse(os.Args[2:])
+		if sqsFlags.NArg() != 1 {
+			exitErrorf("Queue name is required\nUsage: s3-format-fixer sqs [-concurrency n] [-dry-run] [-backup] [-endpoint url] [-region r] [-profile p] [-path-style] [-anonymous] queue-name")
+		}
+
+		sess, err := endpoint.newSession()
+		if err != nil {
+			exitErrorf("Error trying to create the session")
+		}
+
+		runSQSMode(newInterruptContext(), sess, sqsFlags.Arg(0), *concurrency, fixOptions{dryRun: *dryRun, backup: *backup})
+		return
 	}
 
-	bucket := os.Args[1]
-	prefix := os.Args[2]
+	concurrency := flag.Int("concurrency", runtime.NumCPU(), "number of keys to fix concurrently")
+	dryRun := flag.Bool("dry-run", false, "parse and re-marshal without writing the result back")
+	backup := flag.Bool("backup", false, "write the original object to a .bak sibling key before overwriting it")
+	endpoint := registerEndpointFlags(flag.CommandLine)
+	flag.Parse()
+	if flag.NArg() != 2 {
+		exitErrorf("Bucket name is required\nUsage: s3-format-fixer [-concurrency n] [-dry-run] [-backup] [-endpoint url] [-region r] [-profile p] [-path-style] [-anonymous] bucket prefix")
+	}
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-1")},
-	)
+	bucket := flag.Arg(0)
+	prefix := flag.Arg(1)
 
+	sess, err := endpoint.newSession()
 	if err != nil {
 		exitErrorf("Error trying to create the session")
 	}
@@ -108,91 +144,117 @@ func main() {
 	// Create S3 service client
 	svc := s3.New(sess)
 
-	// List object on the bucket to get the keys
-	list, err := svc.ListObjects(&s3.ListObjectsInput{Bucket: aws.String(bucket), MaxKeys: aws.Int64(10000), Prefix: aws.String(prefix)})
-	if err != nil {
-		exitErrorf("Unable to list items in bucket %q, %v", bucket, err)
+	opts := fixOptions{dryRun: *dryRun, backup: *backup}
+	if err := runBucketMode(newInterruptContext(), svc, bucket, prefix, *concurrency, opts); err != nil {
+		exitErrorf("%v", err)
 	}
+}
 
-	l := make([]string, 0)
+// newInterruptContext returns a context that's canceled as soon as the
+// process receives an interrupt (Ctrl-C), so in-flight S3 calls can unwind
+// cleanly instead of the process being killed mid-request.
+func newInterruptContext() context.Context {
+	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt)
+	return ctx
+}
 
-	for _, item := range list.Contents {
-		l = append(l, *item.Key)
+// fixObject fetches item from bucket, re-quotes every newline-delimited
+// record in its contents into strictly valid JSON, and writes the result
+// back in place, preserving the object's compression codec and honoring
+// opts (dry-run, backup).
+func fixObject(ctx context.Context, svc *s3.S3, bucket, item string, opts fixOptions) error {
+	raw, body, contentEncoding, etag, err := fetchAndFix(ctx, svc, bucket, item)
+	if err != nil {
+		return err
 	}
 
-	// Read each object and parse the contents.
-	for _, item := range l {
-		obj, err := svc.GetObject(&s3.GetObjectInput{
-			Bucket: &bucket,
-			Key:    &item,
-		})
-		if err != nil {
-			exitErrorf("Unable to read contents of item %q, %v", item, err)
-		}
-		contents := getContents(obj.Body)
-
-		quotedJSON := parseUnquotedJSON(contents)
+	if opts.dryRun {
+		log.Printf("dry-run: %q would change %d -> %d bytes", item, len(raw), len(body))
+		return nil
+	}
 
-		var event snsEvent
-		err = json.Unmarshal([]byte(quotedJSON), &event)
-		if err != nil {
-			exitErrorf("Unable to unmarshal contents of item %q, %v", item, err)
-		}
+	return writeFixed(ctx, svc, bucket, item, etag, raw, body, contentEncoding, opts)
+}
 
-		// Create correct json and replace the object on S3
+// maxRecordSize bounds how large a single newline-delimited record can be.
+// bufio.Scanner's default 64KB limit is routinely exceeded by SNS message
+// dumps and CloudTrail-style log lines, so the buffer is grown well past
+// that default rather than failing the whole object on one long line.
+const maxRecordSize = 10 * 1024 * 1024
+
+// fetchAndFix downloads item, decompresses it if needed, and re-quotes
+// every newline-delimited record into strictly valid JSON. It returns the
+// original bytes (for -backup), the fixed and re-compressed bytes (for the
+// write-back), the Content-Encoding to set, and the object's ETag.
+func fetchAndFix(ctx context.Context, svc *s3.S3, bucket, item string) (raw, body []byte, contentEncoding, etag string, err error) {
+	obj, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &item,
+	})
+	if err != nil {
+		return nil, nil, "", "", fmt.Errorf("unable to read contents of item %q, %v", item, err)
+	}
+	defer obj.Body.Close()
 
-		b, err := json.Marshal(&event)
-		if err != nil {
-			if e, ok := err.(*json.SyntaxError); ok {
-				log.Printf("Syntax error at byte offset %d", e.Offset)
-			}
-			//log.Printf("Event: %+v", event)
-			log.Printf("Error marshaling event: %v", err)
-		}
+	raw, err = io.ReadAll(obj.Body)
+	if err != nil {
+		return nil, nil, "", "", fmt.Errorf("unable to read contents of item %q, %v", item, err)
+	}
+	if obj.ETag != nil {
+		etag = *obj.ETag
+	}
 
-		// Create correct json and replace the object on S3
+	c := detectCodec(item, obj.ContentEncoding)
+	reader, err := decompress(c, bytes.NewReader(raw))
+	if err != nil {
+		return nil, nil, "", "", fmt.Errorf("unable to decompress item %q, %v", item, err)
+	}
 
-		result, err := svc.PutObject(&s3.PutObjectInput{
-			Body:   aws.ReadSeekCloser(bytes.NewReader(b)),
-			Bucket: aws.String(bucket),
-			Key:    aws.String(item),
-		})
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
 
+		fixed, err := fixRecord(line)
 		if err != nil {
-			if aerr, ok := err.(awserr.Error); ok {
-				switch aerr.Code() {
-				default:
-					fmt.Println(aerr.Error())
-				}
-			} else {
-				// Print the error, cast err to awserr.Error to get the Code and
-				// Message from an error.
-				fmt.Println(err.Error())
-			}
-			return
+			return nil, nil, "", "", fmt.Errorf("unable to fix a record in item %q, %v", item, err)
 		}
+		out.Write(fixed)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, "", "", fmt.Errorf("unable to read contents of item %q, %v", item, err)
+	}
 
-		fmt.Println(result)
+	body, contentEncoding, err = compress(c, out.Bytes())
+	if err != nil {
+		if isUnsupportedCodec(err) {
+			return nil, nil, "", "", err
+		}
+		return nil, nil, "", "", fmt.Errorf("unable to compress item %q, %v", item, err)
 	}
-}
 
-func getContents(contents io.ReadCloser) string {
-	defer contents.Close()
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(contents)
-	newStr := buf.String()
-	return newStr
+	return raw, body, contentEncoding, etag, nil
 }
 
-func parseUnquotedJSON(unquotedJSON string) string {
-	// Add quotes to the field names
-	var re = regexp.MustCompile(`(['"])?([a-z0-9A-Z_]+)(['"])?:\s`)
-	s := re.ReplaceAllString(unquotedJSON, `"$2": `)
-	// Add quotes to the values
-	re = regexp.MustCompile(`: (['"])?([a-z0-9A-Z_\/\.\-\:\?\&\=\+]+)(['"])?`)
-	s = re.ReplaceAllString(s, `: "$2"`)
-	// Remove quotes from the numbers (or at least the ones I expect to be numbers)
-	re = regexp.MustCompile(`: (["']?)([0-9\.]+)(["']?),`)
-	s = re.ReplaceAllString(s, `: $2,`)
-	return s
+// fixRecord re-quotes a single relaxed-JSON SNS event record into strictly
+// valid JSON.
+func fixRecord(record string) ([]byte, error) {
+	var event snsEvent
+	if err := relaxjson.NewDecoder(strings.NewReader(record)).Decode(&event); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal record, %v", err)
+	}
+
+	b, err := json.Marshal(&event)
+	if err != nil {
+		if e, ok := err.(*json.SyntaxError); ok {
+			log.Printf("Syntax error at byte offset %d", e.Offset)
+		}
+		return nil, fmt.Errorf("unable to marshal record, %v", err)
+	}
+	return b, nil
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// maxPutRetries bounds how many times writeFixed re-fetches and retries
+	// a write that lost a race with a concurrent writer.
+	maxPutRetries = 5
+	// putRetryBackoff is the initial delay between retries; it doubles
+	// after each attempt.
+	putRetryBackoff = 200 * time.Millisecond
+)
+
+// writeFixed backs up the original object (if requested) and writes body
+// back to bucket/item, refusing to overwrite it if it changed since etag
+// was captured so a concurrent writer can't be silently clobbered. On a
+// precondition failure it re-fetches and re-fixes the object and retries
+// with exponential backoff, since the object changed underneath us.
+func writeFixed(ctx context.Context, svc *s3.S3, bucket, item, etag string, raw, body []byte, contentEncoding string, opts fixOptions) error {
+	if opts.backup {
+		if err := putBackup(ctx, svc, bucket, item, raw); err != nil {
+			return err
+		}
+	}
+
+	backoff := putRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := putConditional(ctx, svc, bucket, item, etag, body, contentEncoding)
+		if err == nil {
+			return nil
+		}
+
+		if !isPreconditionFailed(err) {
+			if aerr, ok := err.(awserr.Error); ok {
+				return fmt.Errorf(aerr.Error())
+			}
+			return err
+		}
+		if attempt >= maxPutRetries {
+			return err
+		}
+
+		log.Printf("Precondition failed writing %q (object changed concurrently), retrying in %s", item, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+
+		raw, body, contentEncoding, etag, err = fetchAndFix(ctx, svc, bucket, item)
+		if err != nil {
+			return err
+		}
+		if opts.backup {
+			if err := putBackup(ctx, svc, bucket, item, raw); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// putConditional writes body back to bucket/item unless the object has
+// changed since etag was captured.
+//
+// This SDK's PutObjectInput predates S3's native If-Match support, so the
+// precondition is approximated with a HeadObject check immediately before
+// the write rather than a true conditional PUT. That still leaves a short
+// race window; it's a best-effort guard against clobbering a concurrent
+// writer, not a hard guarantee.
+func putConditional(ctx context.Context, svc *s3.S3, bucket, item, etag string, body []byte, contentEncoding string) error {
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(item),
+	})
+	if err != nil {
+		return err
+	}
+	if head.ETag == nil || *head.ETag != etag {
+		return &preconditionFailedError{item: item}
+	}
+
+	input := &s3.PutObjectInput{
+		Body:   aws.ReadSeekCloser(bytes.NewReader(body)),
+		Bucket: aws.String(bucket),
+		Key:    aws.String(item),
+	}
+	if contentEncoding != "" {
+		input.ContentEncoding = aws.String(contentEncoding)
+	}
+
+	result, err := svc.PutObjectWithContext(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(result)
+	return nil
+}
+
+// preconditionFailedError signals that an object's ETag no longer matched
+// what we read, so our fix is stale and must be recomputed before retrying.
+type preconditionFailedError struct{ item string }
+
+func (e *preconditionFailedError) Error() string {
+	return fmt.Sprintf("object %q changed since it was read", e.item)
+}
+
+// putBackup writes raw to a ".bak" sibling of item, preserving the original
+// bytes before they're overwritten.
+func putBackup(ctx context.Context, svc *s3.S3, bucket, item string, raw []byte) error {
+	_, err := svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Body:   aws.ReadSeekCloser(bytes.NewReader(raw)),
+		Bucket: aws.String(bucket),
+		Key:    aws.String(item + ".bak"),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write backup of item %q, %v", item, err)
+	}
+	return nil
+}
+
+// isPreconditionFailed reports whether err means the object's ETag no
+// longer matched what we read, i.e. it changed since.
+func isPreconditionFailed(err error) bool {
+	_, ok := err.(*preconditionFailedError)
+	return ok
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// endpointFlags holds the connection settings needed to point the tool at
+// something other than default AWS: MinIO, Ceph, LocalStack, or a
+// non-default AWS profile.
+type endpointFlags struct {
+	region    string
+	endpoint  string
+	profile   string
+	pathStyle bool
+	anonymous bool
+}
+
+// registerEndpointFlags adds -region, -endpoint, -profile, -path-style and
+// -anonymous to fs.
+func registerEndpointFlags(fs *flag.FlagSet) *endpointFlags {
+	f := &endpointFlags{}
+	fs.StringVar(&f.region, "region", "us-east-1", "AWS region (or the region configured on the S3-compatible endpoint)")
+	fs.StringVar(&f.endpoint, "endpoint", "", "S3-compatible endpoint URL, e.g. http://localhost:9000 for MinIO")
+	fs.StringVar(&f.profile, "profile", "", "named profile to load credentials from, instead of the default credential chain")
+	fs.BoolVar(&f.pathStyle, "path-style", false, "use path-style addressing (bucket in the path, not the host) - required by most S3-compatible servers")
+	fs.BoolVar(&f.anonymous, "anonymous", false, "make unsigned, anonymous requests instead of looking up credentials")
+	return f
+}
+
+// newSession builds an AWS session wired up for f's endpoint and
+// credential settings.
+func (f *endpointFlags) newSession() (*session.Session, error) {
+	cfg := &aws.Config{
+		Region:           aws.String(f.region),
+		S3ForcePathStyle: aws.Bool(f.pathStyle),
+	}
+	if f.endpoint != "" {
+		cfg.Endpoint = aws.String(f.endpoint)
+	}
+
+	switch {
+	case f.anonymous:
+		cfg.Credentials = credentials.AnonymousCredentials
+	case f.profile != "":
+		cfg.Credentials = credentials.NewSharedCredentials("", f.profile)
+	}
+
+	return session.NewSession(cfg)
+}
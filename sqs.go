@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// s3ObjectNotification is the shape of a single record inside a native
+// S3 bucket notification (s3:ObjectCreated:*).
+type s3ObjectNotification struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// snsEnvelope wraps an S3 notification when the bucket is configured to
+// publish to an SNS topic that in turn fans out to the SQS queue, rather
+// than the queue subscribing to the bucket directly.
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// objectRef identifies a single S3 object a worker should fix.
+type objectRef struct {
+	bucket string
+	key    string
+}
+
+// runSQSMode polls queueName for S3 object-created notifications and keeps
+// fixing the referenced objects, fanned out across concurrency workers,
+// until ctx is canceled.
+func runSQSMode(ctx context.Context, sess *session.Session, queueName string, concurrency int, opts fixOptions) {
+	svc := s3.New(sess)
+	sqsSvc := sqs.New(sess)
+
+	queueURL, err := sqsSvc.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String(queueName)})
+	if err != nil {
+		exitErrorf("Unable to resolve queue URL for %q, %v", queueName, err)
+	}
+
+	jobs := make(chan sqsJob)
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			sqsWorker(ctx, sqsSvc, queueURL.QueueUrl, jobs, opts)
+		}()
+	}
+
+	log.Printf("Listening on queue %q for S3 object-created notifications", queueName)
+	for ctx.Err() == nil {
+		out, err := sqsSvc.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            queueURL.QueueUrl,
+			MaxNumberOfMessages: aws.Int64(10),
+			WaitTimeSeconds:     aws.Int64(20),
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("Error receiving messages from %q, %v", queueName, err)
+			continue
+		}
+
+		for _, msg := range out.Messages {
+			refs, err := parseNotification(*msg.Body)
+			if err != nil {
+				log.Printf("Skipping message %s, %v", *msg.MessageId, err)
+				continue
+			}
+			if len(refs) == 0 {
+				// Nothing to fix (e.g. S3's subscription-confirmation test
+				// event) - there's nothing a retry would accomplish either.
+				deleteMessage(ctx, sqsSvc, queueURL.QueueUrl, msg.ReceiptHandle)
+				continue
+			}
+
+			state := &messageState{remaining: int32(len(refs))}
+			for _, ref := range refs {
+				select {
+				case jobs <- sqsJob{svc: svc, ref: ref, receiptHandle: msg.ReceiptHandle, queueURL: queueURL.QueueUrl, sqsSvc: sqsSvc, msg: state}:
+				case <-ctx.Done():
+				}
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// messageState tracks how many of a single SQS message's refs are still
+// outstanding, so the message is only deleted once every ref it named has
+// been fixed - and left alone, for the whole batch to retry, if any of
+// them failed.
+type messageState struct {
+	remaining int32
+	failed    int32
+}
+
+// sqsJob is the unit of work handed to a worker: fix ref and, once every
+// ref sharing msg has been processed successfully, delete the SQS message
+// that announced them.
+type sqsJob struct {
+	svc           *s3.S3
+	sqsSvc        *sqs.SQS
+	ref           objectRef
+	receiptHandle *string
+	queueURL      *string
+	msg           *messageState
+}
+
+func sqsWorker(ctx context.Context, sqsSvc *sqs.SQS, queueURL *string, jobs <-chan sqsJob, opts fixOptions) {
+	for job := range jobs {
+		if err := fixObject(ctx, job.svc, job.ref.bucket, job.ref.key, opts); err != nil {
+			if isUnsupportedCodec(err) {
+				log.Printf("Skipping %s/%s, %v", job.ref.bucket, job.ref.key, err)
+			} else {
+				log.Printf("Unable to fix %s/%s, leaving message for retry: %v", job.ref.bucket, job.ref.key, err)
+				atomic.StoreInt32(&job.msg.failed, 1)
+			}
+		}
+
+		if atomic.AddInt32(&job.msg.remaining, -1) > 0 {
+			// Other refs from the same message are still being processed.
+			continue
+		}
+		if atomic.LoadInt32(&job.msg.failed) != 0 {
+			// At least one ref failed - leave the message for the queue's
+			// visibility timeout / DLQ to retry the whole batch.
+			continue
+		}
+		deleteMessage(ctx, job.sqsSvc, job.queueURL, job.receiptHandle)
+	}
+}
+
+func deleteMessage(ctx context.Context, sqsSvc *sqs.SQS, queueURL, receiptHandle *string) {
+	_, err := sqsSvc.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      queueURL,
+		ReceiptHandle: receiptHandle,
+	})
+	if err != nil {
+		log.Printf("Failed to delete SQS message: %v", err)
+	}
+}
+
+// parseNotification accepts either a native S3 event notification or an
+// SNS-wrapped one and returns the bucket/key pairs it announces.
+func parseNotification(body string) ([]objectRef, error) {
+	var envelope snsEnvelope
+	if err := json.Unmarshal([]byte(body), &envelope); err == nil && envelope.Type == "Notification" {
+		body = envelope.Message
+	}
+
+	var notification s3ObjectNotification
+	if err := json.Unmarshal([]byte(body), &notification); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal S3 event notification, %v", err)
+	}
+
+	refs := make([]objectRef, 0, len(notification.Records))
+	for _, record := range notification.Records {
+		refs = append(refs, objectRef{bucket: record.S3.Bucket.Name, key: record.S3.Object.Key})
+	}
+	return refs, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseNotification(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []objectRef
+	}{
+		{
+			name: "native S3 event notification",
+			body: `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"my-bucket"},"object":{"key":"events/one.json"}}}]}`,
+			want: []objectRef{{bucket: "my-bucket", key: "events/one.json"}},
+		},
+		{
+			name: "SNS-wrapped S3 event notification",
+			body: `{"Type":"Notification","Message":"{\"Records\":[{\"eventName\":\"ObjectCreated:Put\",\"s3\":{\"bucket\":{\"name\":\"my-bucket\"},\"object\":{\"key\":\"events/one.json\"}}}]}"}`,
+			want: []objectRef{{bucket: "my-bucket", key: "events/one.json"}},
+		},
+		{
+			name: "multiple records in one message",
+			body: `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"my-bucket"},"object":{"key":"a.json"}}},{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"my-bucket"},"object":{"key":"b.json"}}}]}`,
+			want: []objectRef{{bucket: "my-bucket", key: "a.json"}, {bucket: "my-bucket", key: "b.json"}},
+		},
+		{
+			name: "subscription-confirmation event has no records",
+			body: `{"Type":"SubscriptionConfirmation","Message":"You have chosen to subscribe..."}`,
+			want: []objectRef{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNotification(tt.body)
+			if err != nil {
+				t.Fatalf("parseNotification(%q) returned error: %v", tt.body, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNotification(%q) = %#v, want %#v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNotificationInvalidJSON(t *testing.T) {
+	if _, err := parseNotification("not json"); err == nil {
+		t.Fatal("parseNotification(\"not json\") returned no error, want one")
+	}
+}
+
+func TestMessageStateDeletesOnlyOnceEveryRefSucceeds(t *testing.T) {
+	state := &messageState{remaining: 2}
+
+	if remaining := atomic.AddInt32(&state.remaining, -1); remaining <= 0 {
+		t.Fatalf("remaining = %d after first ref, want > 0", remaining)
+	}
+	if atomic.LoadInt32(&state.failed) != 0 {
+		t.Fatal("failed flag set after a successful ref")
+	}
+
+	if remaining := atomic.AddInt32(&state.remaining, -1); remaining > 0 {
+		t.Fatalf("remaining = %d after last ref, want <= 0", remaining)
+	}
+	if atomic.LoadInt32(&state.failed) != 0 {
+		t.Fatal("failed flag should still be unset, nothing failed")
+	}
+}
+
+func TestMessageStateLeavesMessageWhenARefFails(t *testing.T) {
+	state := &messageState{remaining: 2}
+
+	atomic.StoreInt32(&state.failed, 1)
+	atomic.AddInt32(&state.remaining, -1)
+	if remaining := atomic.AddInt32(&state.remaining, -1); remaining > 0 {
+		t.Fatalf("remaining = %d after last ref, want <= 0", remaining)
+	}
+	if atomic.LoadInt32(&state.failed) == 0 {
+		t.Fatal("failed flag should be set, one ref failed")
+	}
+}